@@ -0,0 +1,118 @@
+package publisher_test
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/announce/message"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSender is an announce.Sender that records the CID of every
+// message it is sent, so tests can check what Announce actually announced.
+type recordingSender struct {
+	mu   sync.Mutex
+	cids []cid.Cid
+}
+
+func (s *recordingSender) Send(_ context.Context, msg message.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cids = append(s.cids, msg.Cid)
+	return nil
+}
+
+func (s *recordingSender) Close() error { return nil }
+
+func (s *recordingSender) sent() []cid.Cid {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.cids)
+}
+
+// TestAnnounceLatest checks that Announce with a nil link re-announces the
+// current head, without publishing a new advertisement.
+func TestAnnounceLatest(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	sender := &recordingSender{}
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st, publisher.WithAnnounceSenders(sender))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	ctx := context.Background()
+	digests := []mh.Multihash{randomMultihash(t)}
+	link, err := pub.Publish(ctx, peer.AddrInfo{ID: pid}, "announce-context", slices.Values(digests), metadata.Default.New())
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Announce(ctx, nil))
+
+	sent := sender.sent()
+	require.Len(t, sent, 2, "one announcement from Publish, one from Announce")
+	require.Equal(t, link.(cidlink.Link).Cid, sent[1])
+}
+
+// TestAnnounceExplicitLink checks that Announce re-sends an announcement
+// for a specific, already-published advertisement, rather than the head.
+func TestAnnounceExplicitLink(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	sender := &recordingSender{}
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st, publisher.WithAnnounceSenders(sender))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	ctx := context.Background()
+	firstLink, err := pub.Publish(ctx, peer.AddrInfo{ID: pid}, "announce-context-1", slices.Values([]mh.Multihash{randomMultihash(t)}), metadata.Default.New())
+	require.NoError(t, err)
+	_, err = pub.Publish(ctx, peer.AddrInfo{ID: pid}, "announce-context-2", slices.Values([]mh.Multihash{randomMultihash(t)}), metadata.Default.New())
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Announce(ctx, firstLink))
+
+	sent := sender.sent()
+	require.Len(t, sent, 3, "two announcements from Publish, one from the explicit Announce")
+	require.Equal(t, firstLink.(cidlink.Link).Cid, sent[2])
+}
+
+// TestAnnounceNoAdvertisements checks that Announce with a nil link fails
+// with ErrNoAdvertisements if nothing has been published yet.
+func TestAnnounceNoAdvertisements(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st, publisher.WithAnnounceSenders(&recordingSender{}))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	err = pub.Announce(context.Background(), nil)
+	require.ErrorIs(t, err, publisher.ErrNoAdvertisements)
+}
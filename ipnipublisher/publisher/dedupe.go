@@ -0,0 +1,74 @@
+package publisher
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+// dedupeFilter is a Bloom filter recording which multihashes this publisher
+// has already advertised, so that Entries can filter out multihashes that
+// would otherwise be re-advertised, possibly under a different context ID.
+// Like any Bloom filter it can have false positives, meaning a multihash is
+// occasionally skipped even though it was never actually advertised before,
+// but it never has false negatives.
+type dedupeFilter struct {
+	mu   sync.Mutex
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newDedupeFilter sizes a Bloom filter to hold about n items at the given
+// false positive rate, using the standard optimal m (number of bits) and k
+// (number of hash functions) formulas.
+func newDedupeFilter(n uint64, fpRate float64) *dedupeFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m == 0 {
+		m = 1
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &dedupeFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// testAndAdd reports whether digest had not already been recorded in the
+// filter, recording it as a side effect. A false return means digest was
+// (or, due to a false positive, merely looks like it was) already recorded.
+func (f *dedupeFilter) testAndAdd(digest mh.Multihash) bool {
+	h1, h2 := dedupeHashPair(digest)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	isNew := false
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.bits[word]&mask == 0 {
+			isNew = true
+			f.bits[word] |= mask
+		}
+	}
+	return isNew
+}
+
+// dedupeHashPair derives two independent 64-bit hashes of digest, used to
+// simulate the filter's k hash functions via Kirsch-Mitzenmacher double
+// hashing (h1 + i*h2), so a single fast hash suffices for any filter size.
+func dedupeHashPair(digest mh.Multihash) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(digest)
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64()
+	return h1, h2
+}
@@ -0,0 +1,61 @@
+package publisher_test
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEntriesDedupe checks that Entries filters out a multihash that was
+// already seen in an earlier call, even though it is being advertised
+// under a different context ID this time.
+func TestEntriesDedupe(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st, publisher.WithEntriesDedupe(1000, 0.01))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	shared := randomMultihash(t)
+	first := randomMultihash(t)
+	second := randomMultihash(t)
+
+	firstBatch := slices.Collect(pub.Entries(slices.Values([]mh.Multihash{shared, first})))
+	require.ElementsMatch(t, []mh.Multihash{shared, first}, firstBatch)
+
+	secondBatch := slices.Collect(pub.Entries(slices.Values([]mh.Multihash{shared, second})))
+	require.ElementsMatch(t, []mh.Multihash{second}, secondBatch)
+}
+
+// TestEntriesNoDedupe checks that Entries passes digests through unchanged
+// when the publisher was not created with WithEntriesDedupe.
+func TestEntriesNoDedupe(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	shared := randomMultihash(t)
+	firstBatch := slices.Collect(pub.Entries(slices.Values([]mh.Multihash{shared})))
+	require.ElementsMatch(t, []mh.Multihash{shared}, firstBatch)
+	secondBatch := slices.Collect(pub.Entries(slices.Values([]mh.Multihash{shared})))
+	require.ElementsMatch(t, []mh.Multihash{shared}, secondBatch)
+}
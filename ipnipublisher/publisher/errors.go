@@ -0,0 +1,31 @@
+package publisher
+
+import "errors"
+
+var (
+	// ErrContextIDNotFound signals that no item is associated to the given
+	// context ID.
+	ErrContextIDNotFound = errors.New("context ID not found")
+
+	// ErrAlreadyAdvertised signals that an advertisement for identical content
+	// was already published.
+	ErrAlreadyAdvertised = errors.New("advertisement already published")
+
+	// ErrNoAdvertisements signals that no advertisement has been published
+	// yet, so there is nothing to announce.
+	ErrNoAdvertisements = errors.New("no advertisements published yet")
+
+	// ErrPublisherClosed signals that the publisher has been closed and no
+	// longer accepts new publish requests.
+	ErrPublisherClosed = errors.New("publisher closed")
+
+	// ErrNoCheckpoint signals that Resume was called for a context ID for
+	// which no segment of a segmented publish is in the advertisement chain.
+	ErrNoCheckpoint = errors.New("no segmented publish checkpoint for context ID")
+
+	// ErrSuperseded signals that a concurrent Publish call for the same
+	// provider and contextID was coalesced into a later call, so this
+	// call's own digests and metadata were never published. The caller
+	// should retry if it still needs its own update reflected in the chain.
+	ErrSuperseded = errors.New("publish superseded by a concurrent call for the same contextID")
+)
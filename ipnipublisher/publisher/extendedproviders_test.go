@@ -0,0 +1,92 @@
+package publisher_test
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPublishExtendedProviders checks that the resulting advertisement
+// carries a verifiable signature for every listed provider, including the
+// publisher's own.
+func TestPublishExtendedProviders(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	selfAddr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/3104")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	link, err := pub.PublishExtendedProviders(
+		ctx,
+		"extended-providers-context",
+		[]peer.AddrInfo{
+			{ID: pid, Addrs: []multiaddr.Multiaddr{selfAddr}},
+		},
+		[]metadata.Metadata{
+			metadata.Default.New(&metadata.Bitswap{}),
+		},
+		false,
+	)
+	require.NoError(t, err)
+	require.NotNil(t, link)
+
+	adv, err := st.Advert(ctx, link)
+	require.NoError(t, err)
+	require.NotNil(t, adv.ExtendedProvider)
+	require.Len(t, adv.ExtendedProvider.Providers, 1)
+
+	signerID, err := adv.VerifySignature()
+	require.NoError(t, err)
+	require.Equal(t, pid, signerID)
+}
+
+// TestPublishExtendedProvidersRequiresSelf checks that listing only a
+// provider other than the publisher's own identity is rejected, since this
+// publisher has no way to produce a valid signature on that provider's
+// behalf.
+func TestPublishExtendedProvidersRequiresSelf(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	otherPriv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	otherPid, err := peer.IDFromPrivateKey(otherPriv)
+	require.NoError(t, err)
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	ctx := context.Background()
+	_, err = pub.PublishExtendedProviders(
+		ctx,
+		"extended-providers-context",
+		[]peer.AddrInfo{{ID: otherPid}},
+		[]metadata.Metadata{metadata.Default.New(&metadata.Bitswap{})},
+		false,
+	)
+	require.Error(t, err)
+}
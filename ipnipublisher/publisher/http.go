@@ -0,0 +1,118 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/dagsync/ipnisync"
+	"github.com/ipni/go-libipni/maurl"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+)
+
+// httpListener wraps the ipnisync server (and, optionally, the libp2p host
+// used to serve it over HTTP-over-libp2p) started by WithHTTPListener.
+type httpListener struct {
+	pub  *ipnisync.Publisher
+	host host.Host
+}
+
+func (l *httpListener) setRoot(c cidlink.Link) {
+	l.pub.SetRoot(c.Cid)
+}
+
+func (l *httpListener) close() error {
+	err := l.pub.Close()
+	if l.host != nil {
+		if hErr := l.host.Close(); hErr != nil && err == nil {
+			err = hErr
+		}
+	}
+	return err
+}
+
+// startHTTPListener starts an ipnisync-compatible HTTP server, backed by
+// pubStore, that serves the advertisement chain directly to indexers that
+// prefer pull-based ingestion.
+func startHTTPListener(o *options, key crypto.PrivKey, pubStore store.PublisherStore) (*httpListener, error) {
+	encStore, ok := pubStore.(store.EncodeableStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not implement store.EncodeableStore, required by WithHTTPListener")
+	}
+
+	syncOpts := []ipnisync.Option{ipnisync.WithHeadTopic(o.topic)}
+
+	if o.httpListenAddr != "" {
+		maddr, err := multiaddr.NewMultiaddr(o.httpListenAddr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing HTTP listen multiaddr: %w", err)
+		}
+		httpURL, err := maurl.ToURL(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("converting HTTP listen multiaddr to URL: %w", err)
+		}
+		syncOpts = append(syncOpts, ipnisync.WithHTTPListenAddrs(httpURL.Host))
+	}
+
+	var h host.Host
+	if !o.noLibp2pHTTP {
+		var err error
+		h, err = libp2p.New(libp2p.Identity(key))
+		if err != nil {
+			return nil, fmt.Errorf("creating libp2p host for HTTP-over-libp2p: %w", err)
+		}
+		syncOpts = append(syncOpts, ipnisync.WithStreamHost(h))
+	}
+
+	pub, err := ipnisync.NewPublisher(storeLinkSystem(encStore), key, syncOpts...)
+	if err != nil {
+		if h != nil {
+			_ = h.Close()
+		}
+		return nil, fmt.Errorf("starting ipnisync publisher: %w", err)
+	}
+
+	// Seed the listener's root from whatever is already in pubStore, so that
+	// a publisher created against a pre-populated store (for example after a
+	// restart) serves its existing chain immediately, instead of responding
+	// with "no head" until the next Publish call.
+	head, err := pubStore.Head(context.Background())
+	if err != nil && !store.IsNotFound(err) {
+		_ = pub.Close()
+		if h != nil {
+			_ = h.Close()
+		}
+		return nil, fmt.Errorf("reading store head to seed HTTP listener: %w", err)
+	}
+	if head != nil && head.Head != nil {
+		pub.SetRoot(head.Head.(cidlink.Link).Cid)
+	}
+
+	return &httpListener{pub: pub, host: h}, nil
+}
+
+// storeLinkSystem builds an ipld.LinkSystem that reads advertisements and
+// entry chunks out of an EncodeableStore, so that an ipnisync.Publisher can
+// serve them directly to callers pulling the chain over HTTP.
+func storeLinkSystem(es store.EncodeableStore) ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		ctx := lctx.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var buf bytes.Buffer
+		if err := es.Encode(ctx, lnk, &buf); err != nil {
+			return nil, err
+		}
+		return &buf, nil
+	}
+	return lsys
+}
@@ -0,0 +1,244 @@
+// Package mirror re-publishes another IPNI publisher's advertisement chain
+// through a local IPNIPublisher, so that Storacha operators can shadow
+// another provider's content for redundancy or migration.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/ipni/go-libipni/dagsync/ipnisync"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+)
+
+// Mirror walks a remote publisher's advertisement chain over HTTP, using
+// ipnisync, and re-publishes it through a local IPNIPublisher.
+type Mirror struct {
+	local   *publisher.IPNIPublisher
+	localID peer.ID
+	lsys    ipld.LinkSystem
+	sync    *ipnisync.Sync
+	cfg     config
+}
+
+// New creates a Mirror that re-publishes advertisements through local.
+func New(local *publisher.IPNIPublisher, opts ...Option) (*Mirror, error) {
+	cfg := config{mode: ModeIdentity}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.mode == ModeReProvider && cfg.provider.ID == "" {
+		return nil, fmt.Errorf("mirror: WithReProvider is required in ModeReProvider")
+	}
+
+	localID, err := peer.IDFromPrivateKey(local.Key())
+	if err != nil {
+		return nil, fmt.Errorf("mirror: deriving local publisher's peer ID: %w", err)
+	}
+
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	ms := &memstore.Store{}
+	lsys.SetReadStorage(ms)
+	lsys.SetWriteStorage(ms)
+
+	return &Mirror{
+		local:   local,
+		localID: localID,
+		lsys:    lsys,
+		sync:    ipnisync.NewSync(lsys, nil),
+		cfg:     cfg,
+	}, nil
+}
+
+// Mirror fetches source's advertisement chain, starting from
+// WithStartingCID or source's current head, and re-publishes every
+// advertisement walked, oldest first, through the local publisher. It
+// returns the link of the most recent advertisement mirrored, or nil if
+// there was nothing to mirror.
+func (m *Mirror) Mirror(ctx context.Context, source peer.AddrInfo) (ipld.Link, error) {
+	syncer, err := m.sync.NewSyncer(source)
+	if err != nil {
+		return nil, fmt.Errorf("mirror: creating syncer for %s: %w", source.ID, err)
+	}
+
+	start := m.cfg.startingCID
+	if start == cid.Undef {
+		start, err = syncer.GetHead(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("mirror: fetching head of %s: %w", source.ID, err)
+		}
+	}
+
+	// Walk the remote chain backwards, newest first, so we can bound it by
+	// MaxDepth without having to know its length up front.
+	ads, err := m.fetchChain(ctx, syncer, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(ads) == 0 {
+		return nil, nil
+	}
+
+	prevLink, err := m.local.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("mirror: reading local head: %w", err)
+	}
+
+	// Replay oldest first, so the local chain is built in the same order
+	// the source originally published it in.
+	for i := len(ads) - 1; i >= 0; i-- {
+		adv, err := m.transform(ctx, syncer, ads[i], prevLink)
+		if err != nil {
+			return nil, fmt.Errorf("mirror: transforming advertisement: %w", err)
+		}
+		prevLink, err = m.local.PublishAdvertisement(ctx, adv)
+		if err != nil {
+			return nil, fmt.Errorf("mirror: publishing mirrored advertisement: %w", err)
+		}
+	}
+	return prevLink, nil
+}
+
+// fetchChain walks source's advertisement chain backwards from start, for
+// at most MaxDepth advertisements, and returns them newest first.
+func (m *Mirror) fetchChain(ctx context.Context, syncer *ipnisync.Syncer, start cid.Cid) ([]schema.Advertisement, error) {
+	var ads []schema.Advertisement
+	cur := start
+	for i := 0; m.cfg.maxDepth == 0 || i < m.cfg.maxDepth; i++ {
+		if cur == cid.Undef {
+			break
+		}
+		adv, err := m.fetchAdvertisement(ctx, syncer, cur)
+		if err != nil {
+			return nil, fmt.Errorf("fetching advertisement %s: %w", cur, err)
+		}
+		ads = append(ads, adv)
+		cur = adv.PreviousCid()
+	}
+	return ads, nil
+}
+
+// fetchAdvertisement fetches a single advertisement node by CID, without
+// recursing into its entries or previous advertisement.
+func (m *Mirror) fetchAdvertisement(ctx context.Context, syncer *ipnisync.Syncer, c cid.Cid) (schema.Advertisement, error) {
+	if err := syncer.Sync(ctx, c, matcherSelector()); err != nil {
+		return schema.Advertisement{}, err
+	}
+	node, err := m.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, schema.AdvertisementPrototype)
+	if err != nil {
+		return schema.Advertisement{}, err
+	}
+	adv, err := schema.UnwrapAdvertisement(node)
+	if err != nil {
+		return schema.Advertisement{}, err
+	}
+	return *adv, nil
+}
+
+// transform turns a remote advertisement into the one that should be stored
+// and announced locally, according to the configured Mode.
+func (m *Mirror) transform(ctx context.Context, syncer *ipnisync.Syncer, adv schema.Advertisement, prevLink ipld.Link) (schema.Advertisement, error) {
+	if prevLink != nil {
+		adv.PreviousID = prevLink
+	} else {
+		adv.PreviousID = nil
+	}
+
+	if m.cfg.skipEntries {
+		adv.Entries = schema.NoEntries
+	} else if adv.Entries != schema.NoEntries {
+		entriesLink, err := m.mirrorEntries(ctx, syncer, adv.Entries)
+		if err != nil {
+			return schema.Advertisement{}, fmt.Errorf("mirroring entries: %w", err)
+		}
+		adv.Entries = entriesLink
+	}
+
+	if m.cfg.mode == ModeIdentity {
+		// PreviousID and Entries were just rewritten above to point into the
+		// local chain and local entries storage, so the source's original
+		// signature no longer matches this advertisement's content, and it
+		// must be re-signed with the local key. That makes Provider, which
+		// still names the source, inconsistent with the signer: a
+		// conformant indexer enforces signer == Provider for an
+		// advertisement with no ExtendedProvider, and we hold no key that
+		// lets us sign validly on the source's behalf. So Provider (and
+		// Addresses, which are only meaningful for that Provider) are
+		// overwritten with the local publisher's own identity too, making
+		// the advertisement internally consistent at the cost of no longer
+		// actually preserving the source's advertised identity.
+		adv.Provider = m.localID.String()
+		adv.Addresses = nil
+		adv.Signature = nil
+		if err := adv.Sign(m.local.Key()); err != nil {
+			return schema.Advertisement{}, fmt.Errorf("signing mirrored advertisement: %w", err)
+		}
+		return adv, nil
+	}
+
+	adv.Provider = m.cfg.provider.ID.String()
+	adv.Addresses = make([]string, len(m.cfg.provider.Addrs))
+	for i, addr := range m.cfg.provider.Addrs {
+		adv.Addresses[i] = addr.String()
+	}
+	adv.Signature = nil
+	if err := adv.Sign(m.local.Key()); err != nil {
+		return schema.Advertisement{}, fmt.Errorf("signing re-provided advertisement: %w", err)
+	}
+	return adv, nil
+}
+
+// mirrorEntries fetches every multihash reachable from entriesRoot and
+// copies them into the local publisher's own entries storage, returning the
+// link of the resulting, locally-addressed, entries chunk.
+func (m *Mirror) mirrorEntries(ctx context.Context, syncer *ipnisync.Syncer, entriesRoot ipld.Link) (ipld.Link, error) {
+	if entriesRoot == nil {
+		return schema.NoEntries, nil
+	}
+
+	var digests []mh.Multihash
+	cur := entriesRoot.(cidlink.Link).Cid
+	for cur != cid.Undef {
+		if err := syncer.Sync(ctx, cur, matcherSelector()); err != nil {
+			return nil, fmt.Errorf("fetching entry chunk %s: %w", cur, err)
+		}
+		node, err := m.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: cur}, schema.EntryChunkPrototype)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := schema.UnwrapEntryChunk(node)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, chunk.Entries...)
+		if chunk.Next == nil {
+			break
+		}
+		cur = chunk.Next.(cidlink.Link).Cid
+	}
+
+	return m.local.PutEntries(ctx, slices.Values(digests))
+}
+
+// matcherSelector selects exactly the node it is given, without recursing
+// into any of its links. Used to fetch one advertisement or entry chunk at
+// a time, since mirroring needs to inspect and transform each one before
+// deciding whether, and how far, to keep walking.
+func matcherSelector() ipld.Node {
+	np := basicnode.Prototype__Any{}
+	ssb := selectorbuilder.NewSelectorSpecBuilder(np)
+	return ssb.Matcher().Node()
+}
@@ -0,0 +1,89 @@
+package mirror_test
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher/mirror"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMirrorIdentityRoundTrip mirrors a source publisher's chain, including
+// its entries, into a second, local publisher, and checks that the mirrored
+// advertisement verifies and carries the same digests as the source.
+func TestMirrorIdentityRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	sourcePriv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	sourcePid, err := peer.IDFromPrivateKey(sourcePriv)
+	require.NoError(t, err)
+
+	sourceStore := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	sourceListenAddr := "/ip4/127.0.0.1/tcp/3105/http"
+	source, err := publisher.New(sourcePriv, sourceStore, publisher.WithHTTPListener(sourceListenAddr, true))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, source.Close(ctx))
+	})
+
+	digests := []mh.Multihash{randomMultihash(t), randomMultihash(t)}
+	_, err = source.Publish(ctx, peer.AddrInfo{ID: sourcePid}, "mirrored-context", slices.Values(digests), metadata.Default.New(&metadata.Bitswap{}))
+	require.NoError(t, err)
+
+	localPriv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	localPid, err := peer.IDFromPrivateKey(localPriv)
+	require.NoError(t, err)
+
+	localStore := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	local, err := publisher.New(localPriv, localStore)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, local.Close(ctx))
+	})
+
+	m, err := mirror.New(local)
+	require.NoError(t, err)
+
+	listenMaddr, err := multiaddr.NewMultiaddr(sourceListenAddr)
+	require.NoError(t, err)
+	link, err := m.Mirror(ctx, peer.AddrInfo{Addrs: []multiaddr.Multiaddr{listenMaddr}})
+	require.NoError(t, err)
+	require.NotNil(t, link)
+
+	adv, err := localStore.Advert(ctx, link)
+	require.NoError(t, err)
+
+	signerID, err := adv.VerifySignature()
+	require.NoError(t, err)
+	require.Equal(t, localPid, signerID, "identity mode re-signs with the local key")
+	require.Equal(t, localPid.String(), adv.Provider, "provider must match the signer, or a conformant indexer would reject the ad")
+
+	var mirrored []mh.Multihash
+	for d, err := range localStore.Entries(ctx, adv.Entries) {
+		require.NoError(t, err)
+		mirrored = append(mirrored, d)
+	}
+	require.ElementsMatch(t, digests, mirrored)
+}
+
+func randomMultihash(t *testing.T) mh.Multihash {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	digest, err := mh.Sum(b, mh.SHA2_256, -1)
+	require.NoError(t, err)
+	return digest
+}
@@ -0,0 +1,87 @@
+package mirror
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Mode selects how a remote advertisement is transformed before it is
+// re-published locally.
+type Mode int
+
+const (
+	// ModeIdentity re-publishes advertisements under the local publisher's
+	// own identity: every mirrored advertisement is re-signed with the
+	// local publisher's key, because PreviousID and Entries are rewritten
+	// to point into the local chain and local entries storage, so the
+	// source's original signature can never be carried over. Provider and
+	// Addresses are overwritten to match the local signer, rather than
+	// kept as the source's, since a conformant indexer enforces signer ==
+	// Provider and there is no key available to sign validly on the
+	// source's behalf. Despite the name, this mode does not preserve the
+	// source's advertised identity; it only preserves the content. This is
+	// the default mode.
+	ModeIdentity Mode = iota
+
+	// ModeReProvider rewrites the Provider and Addresses of every mirrored
+	// advertisement to the peer configured with WithReProvider, and
+	// re-signs it with the local key, so that peer is advertised as the
+	// provider of the mirrored content. The signature matches Provider only
+	// when that peer is the local publisher's own identity.
+	ModeReProvider
+)
+
+// Option is an option configuring a Mirror.
+type Option func(cfg *config) error
+
+type config struct {
+	mode        Mode
+	provider    peer.AddrInfo
+	startingCID cid.Cid
+	maxDepth    int
+	skipEntries bool
+}
+
+// WithReProvider switches the mirror to ModeReProvider, rewriting the
+// Provider and Addresses of every mirrored advertisement to provider and
+// re-signing it with the local publisher's key.
+func WithReProvider(provider peer.AddrInfo) Option {
+	return func(cfg *config) error {
+		cfg.mode = ModeReProvider
+		cfg.provider = provider
+		return nil
+	}
+}
+
+// WithStartingCID has the mirror start walking the source's advertisement
+// chain from c, instead of from the source's current head. This is useful
+// for resuming a mirror from a checkpoint recorded by a previous run.
+func WithStartingCID(c cid.Cid) Option {
+	return func(cfg *config) error {
+		cfg.startingCID = c
+		return nil
+	}
+}
+
+// WithMaxDepth bounds how many advertisements, at most, are walked back from
+// the starting point in a single call to Mirror. The zero value, the
+// default, means no limit: the chain is walked back to its beginning.
+func WithMaxDepth(depth int) Option {
+	return func(cfg *config) error {
+		cfg.maxDepth = depth
+		return nil
+	}
+}
+
+// WithSkipEntries has the mirror republish only advertisement metadata,
+// without fetching or re-chunking the source's multihashes. Mirrored
+// advertisements carry schema.NoEntries instead of a copy of the source's
+// entries, matching the "entries-skip" mirror-over-HTTP pattern used by
+// index-provider, for operators that only want to shadow the existence of
+// content rather than its bytes.
+func WithSkipEntries() Option {
+	return func(cfg *config) error {
+		cfg.skipEntries = true
+		return nil
+	}
+}
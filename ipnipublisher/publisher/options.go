@@ -0,0 +1,148 @@
+package publisher
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/ipni/go-libipni/announce"
+	"github.com/ipni/go-libipni/announce/p2psender"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Option is an option configuring a publisher.
+type Option func(cfg *options) error
+
+type options struct {
+	pubHTTPAnnounceAddrs []multiaddr.Multiaddr
+	topic                string
+	announceURLs         []*url.URL
+
+	serveHTTP      bool
+	httpListenAddr string
+	noLibp2pHTTP   bool
+
+	senders    []announce.Sender
+	p2pHost    host.Host
+	pubsubOpts []p2psender.Option
+
+	segmentSize int
+
+	dedupeFilterSize uint64
+	dedupeFPRate     float64
+}
+
+// WithDirectAnnounce sets indexer URLs to send direct HTTP announcements to.
+func WithDirectAnnounce(announceURLs ...string) Option {
+	return func(o *options) error {
+		for _, urlStr := range announceURLs {
+			u, err := url.Parse(urlStr)
+			if err != nil {
+				return err
+			}
+			o.announceURLs = append(o.announceURLs, u)
+		}
+		return nil
+	}
+}
+
+// WithAnnounceAddrs configures the multiaddrs that are put into announce
+// messages to tell indexers the addresses to fetch advertisements from.
+func WithAnnounceAddrs(addrs ...string) Option {
+	return func(opts *options) error {
+		for _, addr := range addrs {
+			if addr != "" {
+				maddr, err := multiaddr.NewMultiaddr(addr)
+				if err != nil {
+					return err
+				}
+				opts.pubHTTPAnnounceAddrs = append(opts.pubHTTPAnnounceAddrs, maddr)
+			}
+		}
+		return nil
+	}
+}
+
+func WithTopic(topic string) Option {
+	return func(opts *options) error {
+		opts.topic = topic
+		return nil
+	}
+}
+
+// WithPubSubAnnounce has the publisher additionally announce new
+// advertisements over the given libp2p host's gossip pubsub, on the
+// publisher's topic (see WithTopic).
+func WithPubSubAnnounce(p2pHost host.Host, opts ...p2psender.Option) Option {
+	return func(o *options) error {
+		o.p2pHost = p2pHost
+		o.pubsubOpts = opts
+		return nil
+	}
+}
+
+// WithAnnounceSenders adds arbitrary announce.Sender implementations that
+// every published advertisement is announced to, in addition to any senders
+// configured via WithDirectAnnounce or WithPubSubAnnounce. This allows
+// callers to plug in transports not otherwise supported by this package.
+func WithAnnounceSenders(senders ...announce.Sender) Option {
+	return func(o *options) error {
+		o.senders = append(o.senders, senders...)
+		return nil
+	}
+}
+
+// WithHTTPListener has the publisher serve its own advertisement chain over
+// HTTP using an ipnisync-compatible server, instead of only pushing
+// announcements to remote indexers. This lets indexers pull the ad chain
+// directly from `/ipni/v1/ad/{cid}` and `/head`.
+//
+// listenMultiaddr is the plain HTTP address to listen on, for example
+// "/ip4/0.0.0.0/tcp/3104/http". It may be left empty to serve exclusively
+// over HTTP-over-libp2p (see noLibp2p).
+//
+// noLibp2p disables serving over HTTP-over-libp2p. When false, the publisher
+// also creates a libp2p host, using the publisher's private key, to serve
+// the same advertisement chain over libp2p streams. Combining a non-empty
+// listenMultiaddr with noLibp2p set to false serves both transports at once.
+//
+// The store passed to New must implement store.EncodeableStore for this
+// option to be usable.
+func WithHTTPListener(listenMultiaddr string, noLibp2p bool) Option {
+	return func(o *options) error {
+		o.serveHTTP = true
+		o.httpListenAddr = listenMultiaddr
+		o.noLibp2pHTTP = noLibp2p
+		return nil
+	}
+}
+
+// WithSegmentSize sets the default segment size used by PublishSegmented
+// when called with a segmentSize of zero. If WithSegmentSize is not used
+// either, PublishSegmented falls back to defaultSegmentSize.
+func WithSegmentSize(segmentSize int) Option {
+	return func(o *options) error {
+		o.segmentSize = segmentSize
+		return nil
+	}
+}
+
+// WithEntriesDedupe has Entries filter out multihashes that this publisher
+// has already advertised, possibly under a different context ID, using a
+// Bloom filter sized to hold about filterSize multihashes at the given
+// false positive rate. A false positive only causes a multihash to be
+// skipped as if already advertised; it never causes one to be advertised
+// twice.
+func WithEntriesDedupe(filterSize uint64, fpRate float64) Option {
+	return func(o *options) error {
+		if filterSize == 0 {
+			return fmt.Errorf("entries dedupe filter size must be greater than zero")
+		}
+		if fpRate <= 0 || fpRate >= 1 {
+			return fmt.Errorf("entries dedupe false positive rate must be between 0 and 1")
+		}
+		o.dedupeFilterSize = filterSize
+		o.dedupeFPRate = fpRate
+		return nil
+	}
+}
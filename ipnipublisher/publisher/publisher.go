@@ -5,12 +5,15 @@ import (
 	"encoding/base64"
 	"fmt"
 	"iter"
+	"sync"
 
+	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipni/go-libipni/announce"
 	"github.com/ipni/go-libipni/announce/httpsender"
+	"github.com/ipni/go-libipni/announce/p2psender"
 	"github.com/ipni/go-libipni/dagsync/ipnisync/head"
 	"github.com/ipni/go-libipni/ingest/schema"
 	"github.com/ipni/go-libipni/metadata"
@@ -25,34 +28,195 @@ var log = logging.Logger("publisher")
 
 type Publisher interface {
 	// Publish creates, signs and publishes an advert. It then announces the new
-	// advert to other indexers.
+	// advert to other indexers. Concurrent calls sharing a provider and
+	// contextID may be coalesced and may fail with ErrSuperseded: see the
+	// IPNIPublisher.Publish doc comment.
 	Publish(ctx context.Context, provider peer.AddrInfo, contextID string, digests iter.Seq[mh.Multihash], meta metadata.Metadata) (ipld.Link, error)
+
+	// PublishExtendedProviders creates, signs and publishes an advertisement
+	// for the ExtendedProviders extension, announcing a set of providers
+	// capable of retrieving the content under contextID, without adding any
+	// entries of its own.
+	PublishExtendedProviders(ctx context.Context, contextID string, providers []peer.AddrInfo, metas []metadata.Metadata, override bool) (ipld.Link, error)
 }
 
 type IPNIPublisher struct {
 	*options
-	sender announce.Sender
-	key    crypto.PrivKey
-	store  store.PublisherStore
+	senders []announce.Sender
+	id      peer.ID
+	key     crypto.PrivKey
+	store   store.PublisherStore
+	http    *httpListener
+
+	requests chan publishRequest
+	done     chan struct{}
+	closeMu  sync.RWMutex
+	closed   bool
+
+	dedupe *dedupeFilter
 }
 
 // Publish creates a new advertisement from the latest head, signs it, and publishes it.
-// Publish is not safe for concurrent use and advertisements may be lost if called concurrently. A mutex or any other
-// synchronization mechanism must be used around Publish if it will be called from concurrent goroutines.
+// Publish is safe to call concurrently: requests are queued and a single
+// internal goroutine serializes the building of the advert chain, so no
+// advertisements are lost when Publish is called from multiple goroutines.
+//
+// If concurrent calls that share the same provider and contextID are queued
+// together, in the same batch of the writer goroutine, only the most recent
+// of them is actually published; every other call in that batch sharing the
+// pair returns ErrSuperseded instead of a link, since its own digests and
+// metadata were discarded rather than published. Callers that need every
+// call's own digests reflected in the chain must not call Publish
+// concurrently for the same contextID, or must retry on ErrSuperseded.
 func (p *IPNIPublisher) Publish(ctx context.Context, providerInfo peer.AddrInfo, contextID string, digests iter.Seq[mh.Multihash], meta metadata.Metadata) (ipld.Link, error) {
-	link, err := p.publishAdvForIndex(ctx, providerInfo.ID, providerInfo.Addrs, []byte(contextID), meta, false, digests)
+	link, err := p.enqueue(ctx, providerInfo, []byte(contextID), meta, false, digests)
+	if err != nil {
+		return nil, fmt.Errorf("publishing IPNI advert: %w", err)
+	}
+	return link, nil
+}
+
+// PublishExtendedProviders creates, signs and publishes an advertisement for
+// the ExtendedProviders extension, listing a set of providers able to
+// retrieve the content under contextID, in addition to (or, if override is
+// true, instead of) whatever was advertised for that context ID before.
+// Unlike Publish, it adds no entries of its own: it only extends who can
+// retrieve content already advertised elsewhere under the same context ID.
+//
+// providers is a slice rather than a single value because a provider
+// commonly needs to be listed more than once with different addresses and
+// metadata, for example once for bitswap and once for graphsync. metas
+// must be the same length as providers, and give the retrieval metadata
+// for the corresponding entry.
+//
+// This publisher can only sign on behalf of its own identity, derived from
+// the key given to New, so every entry of providers must have that
+// identity; PublishExtendedProviders returns an error otherwise.
+func (p *IPNIPublisher) PublishExtendedProviders(ctx context.Context, contextID string, providers []peer.AddrInfo, metas []metadata.Metadata, override bool) (ipld.Link, error) {
+	if len(providers) != len(metas) {
+		return nil, fmt.Errorf("providers and metas must be the same length")
+	}
+
+	epProviders := make([]schema.Provider, len(providers))
+	for i, providerInfo := range providers {
+		mdBytes, err := metas[i].MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("encoding metadata for extended provider %s: %w", providerInfo.ID, err)
+		}
+		var addrs []string
+		for _, addr := range providerInfo.Addrs {
+			addrs = append(addrs, addr.String())
+		}
+		epProviders[i] = schema.Provider{
+			ID:        providerInfo.ID.String(),
+			Addresses: addrs,
+			Metadata:  mdBytes,
+		}
+	}
+
+	prevHead, err := p.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get latest advertisement: %w", err)
+	}
+
+	adv := schema.Advertisement{
+		Provider:   p.id.String(),
+		PreviousID: prevHead,
+		Entries:    schema.NoEntries,
+		ContextID:  []byte(contextID),
+		ExtendedProvider: &schema.ExtendedProvider{
+			Providers: epProviders,
+			Override:  override,
+		},
+	}
+
+	if err := adv.SignWithExtendedProviders(p.key, p.extendedProviderKey); err != nil {
+		return nil, fmt.Errorf("signing extended providers advertisement: %w", err)
+	}
+
+	link, err := p.PublishAdvertisement(ctx, adv)
+	if err != nil {
+		return nil, fmt.Errorf("publishing extended providers advertisement: %w", err)
+	}
+	return link, nil
+}
+
+// extendedProviderKey returns the private key to sign an extended provider
+// record for id with. This publisher only ever holds one key, so it can
+// only sign on behalf of its own identity.
+func (p *IPNIPublisher) extendedProviderKey(id string) (crypto.PrivKey, error) {
+	if id == p.id.String() {
+		return p.key, nil
+	}
+	return nil, fmt.Errorf("no signing key available for extended provider %q", id)
+}
+
+// PublishAdvertisement stores and announces an advertisement that was
+// already built and signed out-of-band, instead of generating a new one
+// from a digest iterator. It goes through the same single-writer goroutine
+// as Publish, so it is safe to call concurrently with Publish and with
+// itself. This is used by packages such as publisher/mirror that construct
+// advertisements themselves and only need this publisher to store and
+// announce them.
+func (p *IPNIPublisher) PublishAdvertisement(ctx context.Context, adv schema.Advertisement) (ipld.Link, error) {
+	link, err := p.enqueueRaw(ctx, adv)
 	if err != nil {
 		return nil, fmt.Errorf("publishing IPNI advert: %w", err)
 	}
 	return link, nil
 }
 
+// Head returns the link of the most recently published advertisement, or
+// nil if none has been published yet.
+func (p *IPNIPublisher) Head(ctx context.Context) (ipld.Link, error) {
+	h, err := p.store.Head(ctx)
+	if err != nil {
+		if store.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get latest advertisement: %w", err)
+	}
+	return h.Head, nil
+}
+
+// Key returns the private key this publisher signs advertisements with.
+func (p *IPNIPublisher) Key() crypto.PrivKey {
+	return p.key
+}
+
+// Entries filters digests through this publisher's entries dedupe filter,
+// so that multihashes already advertised under a previous call, possibly
+// with a different context ID, are not advertised again. The dedupe filter
+// is only present if the publisher was created with WithEntriesDedupe; if
+// it was not, Entries returns digests unchanged.
+func (p *IPNIPublisher) Entries(digests iter.Seq[mh.Multihash]) iter.Seq[mh.Multihash] {
+	if p.dedupe == nil {
+		return digests
+	}
+	return func(yield func(mh.Multihash) bool) {
+		for digest := range digests {
+			if !p.dedupe.testAndAdd(digest) {
+				continue
+			}
+			if !yield(digest) {
+				return
+			}
+		}
+	}
+}
+
+// PutEntries stores digests as an entries chunk in the local store and
+// returns its link, without building or publishing an advertisement for it.
+// This is exposed for callers, such as publisher/mirror, that need to copy
+// entries into local storage to be referenced by an advertisement built
+// out-of-band.
+func (p *IPNIPublisher) PutEntries(ctx context.Context, digests iter.Seq[mh.Multihash]) (ipld.Link, error) {
+	return p.store.PutEntries(ctx, digests)
+}
+
 var _ Publisher = (*IPNIPublisher)(nil)
 
 // New creates a new IPNI publisher.
-// IPNIPublisher is not safe for concurrent use. There is the risk of losing advertisements if Publish is called
-// from concurrent goroutines. If you will be publishing from multiple goroutines concurrently, a synchronization
-// mechanism (such as sync.Mutex) must be used to ensure that Publish is called serially.
 func New(id crypto.PrivKey, store store.PublisherStore, opts ...Option) (*IPNIPublisher, error) {
 	o := &options{
 		topic: "/indexer/ingest/mainnet",
@@ -68,18 +232,69 @@ func New(id crypto.PrivKey, store store.PublisherStore, opts ...Option) (*IPNIPu
 	if err != nil {
 		return nil, fmt.Errorf("cannot get peer ID from private key: %w", err)
 	}
-	pub := &IPNIPublisher{key: id, store: store, options: o}
+	pub := &IPNIPublisher{id: peer, key: id, store: store, options: o}
 	if len(o.announceURLs) > 0 {
 		sender, err := httpsender.New(o.announceURLs, peer)
 		if err != nil {
 			return nil, fmt.Errorf("cannot create http announce sender: %w", err)
 		}
 		log.Info("HTTP announcements enabled")
-		pub.sender = sender
+		pub.senders = append(pub.senders, sender)
+	}
+	if o.p2pHost != nil {
+		sender, err := p2psender.New(o.p2pHost, o.topic, o.pubsubOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create pubsub announce sender: %w", err)
+		}
+		log.Info("Pubsub announcements enabled")
+		pub.senders = append(pub.senders, sender)
+	}
+	pub.senders = append(pub.senders, o.senders...)
+	if o.serveHTTP {
+		l, err := startHTTPListener(o, id, store)
+		if err != nil {
+			return nil, fmt.Errorf("starting HTTP listener: %w", err)
+		}
+		log.Info("Serving advertisements over HTTP")
+		pub.http = l
 	}
+
+	pub.requests = make(chan publishRequest, requestBufferSize)
+	pub.done = make(chan struct{})
+	if o.dedupeFilterSize > 0 {
+		pub.dedupe = newDedupeFilter(o.dedupeFilterSize, o.dedupeFPRate)
+	}
+	go pub.run()
+
 	return pub, nil
 }
 
+// Close drains any in-flight Publish calls, stops the writer goroutine, and
+// shuts down any resources started by the publisher, such as the HTTP
+// listener started by WithHTTPListener. After Close returns, Publish always
+// fails with ErrPublisherClosed.
+func (p *IPNIPublisher) Close(ctx context.Context) error {
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.requests)
+	p.closeMu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if p.http != nil {
+		return p.http.close()
+	}
+	return nil
+}
+
 func (p *IPNIPublisher) publishAdvForIndex(ctx context.Context, peer peer.ID, addrs []multiaddr.Multiaddr, contextID []byte, md metadata.Metadata, isRm bool, mhs iter.Seq[mh.Multihash]) (ipld.Link, error) {
 	var err error
 
@@ -92,6 +307,15 @@ func (p *IPNIPublisher) publishAdvForIndex(ctx context.Context, peer peer.ID, ad
 		}
 	}
 
+	// newChunkLink is set when this call generates a new entries linked list,
+	// so it can be recorded in the provider + context ID mapping once the
+	// advertisement referencing it has actually been stored. Recording it
+	// any earlier would let a failure to store the advertisement (e.g. a
+	// transient store error) leave the mapping pointing at entries that no
+	// advertisement ever referenced, which would make a retry of this same
+	// publish see it as already advertised and refuse to try again.
+	var newChunkLink ipld.Link
+
 	// If not removing, then generate the link for the list of CIDs from the
 	// contextID using the multihash lister, and store the relationship.
 	if !isRm {
@@ -103,21 +327,15 @@ func (p *IPNIPublisher) publishAdvForIndex(ctx context.Context, peer peer.ID, ad
 
 			// Generate the linked list ipld.Link that is added to the
 			// advertisement and used for ingestion.
-			chunkLink, err = p.store.PutEntries(ctx, mhs)
+			newChunkLink, err = p.store.PutEntries(ctx, mhs)
 			if err != nil {
 				return nil, fmt.Errorf("could not generate entries list: %s", err)
 			}
-			if chunkLink == nil {
+			if newChunkLink == nil {
 				log.Warnw("chunking for context ID resulted in no link", "contextID", contextID)
-				chunkLink = schema.NoEntries
-			}
-
-			// Store the relationship between providerID, contextID and CID of the
-			// advertised list of Cids.
-			err = p.store.PutChunkLinkForProviderAndContextID(ctx, peer, contextID, chunkLink)
-			if err != nil {
-				return nil, fmt.Errorf("failed to write provider + context id to entries cid mapping: %s", err)
+				newChunkLink = schema.NoEntries
 			}
+			chunkLink = newChunkLink
 		} else {
 			// Lookup metadata for this providerID and contextID.
 			prevMetadata, err := p.store.MetadataForProviderAndContextID(ctx, peer, contextID)
@@ -137,10 +355,6 @@ func (p *IPNIPublisher) publishAdvForIndex(ctx context.Context, peer peer.ID, ad
 			// Linked list is the same, but metadata is different, so generate
 			// new advertisement with same linked list, but new metadata.
 		}
-
-		if err = p.store.PutMetadataForProviderAndContextID(ctx, peer, contextID, md); err != nil {
-			return nil, fmt.Errorf("failed to write provider + context id to metadata mapping: %s", err)
-		}
 	} else {
 		log.Info("Creating removal advertisement")
 
@@ -148,17 +362,6 @@ func (p *IPNIPublisher) publishAdvForIndex(ctx context.Context, peer peer.ID, ad
 			return nil, ErrContextIDNotFound
 		}
 
-		// If removing by context ID, it means the list of CIDs is not needed
-		// anymore, so we can remove the entry from the datastore.
-		err = p.store.DeleteChunkLinkForProviderAndContextID(ctx, peer, contextID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to delete provider + context id to entries cid mapping: %s", err)
-		}
-		err = p.store.DeleteMetadataForProviderAndContextID(ctx, peer, contextID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to delete provider + context id to metadata mapping: %s", err)
-		}
-
 		// Create an advertisement to delete content by contextID by specifying
 		// that advertisement has no entries.
 		chunkLink = schema.NoEntries
@@ -208,7 +411,34 @@ func (p *IPNIPublisher) publishAdvForIndex(ctx context.Context, peer peer.ID, ad
 		return nil, err
 	}
 
-	return p.publish(ctx, adv)
+	lnk, err := p.publish(ctx, adv)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only now that the advertisement is durably stored do we record the
+	// provider + context ID mappings it depends on, so a failed publish
+	// can be retried instead of being mistaken for one that already
+	// succeeded.
+	if !isRm {
+		if newChunkLink != nil {
+			if err := p.store.PutChunkLinkForProviderAndContextID(ctx, peer, contextID, newChunkLink); err != nil {
+				return nil, fmt.Errorf("failed to write provider + context id to entries cid mapping: %s", err)
+			}
+		}
+		if err := p.store.PutMetadataForProviderAndContextID(ctx, peer, contextID, md); err != nil {
+			return nil, fmt.Errorf("failed to write provider + context id to metadata mapping: %s", err)
+		}
+	} else {
+		if err := p.store.DeleteChunkLinkForProviderAndContextID(ctx, peer, contextID); err != nil {
+			return nil, fmt.Errorf("failed to delete provider + context id to entries cid mapping: %s", err)
+		}
+		if err := p.store.DeleteMetadataForProviderAndContextID(ctx, peer, contextID); err != nil {
+			return nil, fmt.Errorf("failed to delete provider + context id to metadata mapping: %s", err)
+		}
+	}
+
+	return lnk, nil
 }
 
 func (p *IPNIPublisher) publish(ctx context.Context, adv schema.Advertisement) (ipld.Link, error) {
@@ -217,8 +447,11 @@ func (p *IPNIPublisher) publish(ctx context.Context, adv schema.Advertisement) (
 		log.Errorw("Failed to store advertisement locally", "err", err)
 		return nil, fmt.Errorf("failed to publish advertisement locally: %w", err)
 	}
-	if p.sender != nil {
-		err = announce.Send(ctx, lnk.(cidlink.Link).Cid, p.pubHTTPAnnounceAddrs, p.sender)
+	if p.http != nil {
+		p.http.setRoot(lnk.(cidlink.Link))
+	}
+	if len(p.senders) > 0 {
+		err = announce.Send(ctx, lnk.(cidlink.Link).Cid, p.pubHTTPAnnounceAddrs, p.senders...)
 		if err != nil {
 			log.Errorw("Failed to announce advertisement", "err", err)
 		}
@@ -226,6 +459,45 @@ func (p *IPNIPublisher) publish(ctx context.Context, adv schema.Advertisement) (
 	return lnk, nil
 }
 
+// Announce re-sends an announcement for an already-published advertisement,
+// without generating a new one. This is useful for recovering from a missed
+// or failed announcement without having to republish the entries chain.
+//
+// If adLink is nil, the latest advertisement is announced.
+func (p *IPNIPublisher) Announce(ctx context.Context, adLink ipld.Link) error {
+	c, err := p.announceCid(ctx, adLink)
+	if err != nil {
+		return err
+	}
+	if len(p.senders) == 0 {
+		return nil
+	}
+	return announce.Send(ctx, c, p.pubHTTPAnnounceAddrs, p.senders...)
+}
+
+func (p *IPNIPublisher) announceCid(ctx context.Context, adLink ipld.Link) (cid.Cid, error) {
+	if adLink != nil {
+		cl, ok := adLink.(cidlink.Link)
+		if !ok {
+			return cid.Undef, fmt.Errorf("advertisement link is not a CID link")
+		}
+		return cl.Cid, nil
+	}
+
+	latest, err := p.store.Head(ctx)
+	if err != nil {
+		if store.IsNotFound(err) {
+			return cid.Undef, ErrNoAdvertisements
+		}
+		return cid.Undef, fmt.Errorf("could not get latest advertisement: %w", err)
+	}
+	cl, ok := latest.Head.(cidlink.Link)
+	if !ok {
+		return cid.Undef, fmt.Errorf("latest advertisement link is not a CID link")
+	}
+	return cl.Cid, nil
+}
+
 func (p *IPNIPublisher) publishLocal(ctx context.Context, adv schema.Advertisement) (ipld.Link, error) {
 	if err := adv.Validate(); err != nil {
 		return nil, err
@@ -242,7 +514,12 @@ func (p *IPNIPublisher) publishLocal(ctx context.Context, adv schema.Advertiseme
 		log.Errorw("Failed to generate signed head for the latest advertisement", "err", err)
 		return nil, fmt.Errorf("failed to generate signed head for the latest advertisement: %w", err)
 	}
-	if _, err := p.store.PutHead(ctx, head); err != nil {
+	oldHead, err := p.store.Head(ctx)
+	if err != nil && !store.IsNotFound(err) {
+		log.Errorw("Failed to read previous reference to the latest advertisement", "err", err)
+		return nil, fmt.Errorf("failed to read previous reference to latest advertisement: %w", err)
+	}
+	if _, err := p.store.ReplaceHead(ctx, oldHead, head); err != nil {
 		log.Errorw("Failed to update reference to the latest advertisement", "err", err)
 		return nil, fmt.Errorf("failed to update reference to latest advertisement: %w", err)
 	}
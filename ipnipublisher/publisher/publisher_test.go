@@ -0,0 +1,87 @@
+package publisher_test
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+	"github.com/stretchr/testify/require"
+)
+
+func randomMultihash(t *testing.T) mh.Multihash {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	digest, err := mh.Sum(b, mh.SHA2_256, -1)
+	require.NoError(t, err)
+	return digest
+}
+
+// TestPublishConcurrent hammers Publish from many goroutines at once and
+// checks that every advert ends up in a single, well-formed chain: one link
+// per call, each pointing to the previous one, with no gaps or duplicates.
+func TestPublishConcurrent(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	provInfo := peer.AddrInfo{ID: pid}
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	const goroutines = 20
+
+	ctx := context.Background()
+	links := make([]ipld.Link, goroutines)
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			digests := []mh.Multihash{randomMultihash(t)}
+			contextID := randomMultihash(t).B58String()
+			lnk, err := pub.Publish(ctx, provInfo, contextID, slices.Values(digests), metadata.Default.New())
+			require.NoError(t, err)
+			links[i] = lnk
+		}(i)
+	}
+	wg.Wait()
+
+	for _, lnk := range links {
+		require.NotNil(t, lnk)
+	}
+
+	// Walk the chain from the latest head back to the beginning and check
+	// that it has exactly one entry per Publish call, with no duplicates.
+	head, err := st.Head(ctx)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool, goroutines)
+	cur := head.Head
+	for cur != nil {
+		require.False(t, seen[cur.String()], "advertisement visited twice: chain is malformed")
+		seen[cur.String()] = true
+
+		ad, err := st.Advert(ctx, cur)
+		require.NoError(t, err)
+		cur = ad.PreviousID
+	}
+	require.Len(t, seen, goroutines)
+}
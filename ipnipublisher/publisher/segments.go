@@ -0,0 +1,221 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+)
+
+// defaultSegmentSize is the number of multihashes published per
+// advertisement by PublishSegmented, when neither it nor WithSegmentSize
+// specify one.
+const defaultSegmentSize = 1 << 16
+
+// PublishSegmented splits digests into fixed-size segments and publishes
+// one advertisement per segment, each chained onto the previous with
+// PreviousID, instead of materializing the whole listing into a single
+// advertisement's entries. This bounds memory use and lets a large listing
+// make durable, incremental progress: if publishing a later segment fails,
+// the segments already published remain live in the ad chain, and Resume
+// can be used to continue from there.
+//
+// If segmentSize is zero, the value given to WithSegmentSize is used, or
+// defaultSegmentSize if that option was not set either.
+//
+// PublishSegmented returns the link of the last advertisement it was able
+// to publish. If it returns an error, that link is still valid and
+// announced; the error means some digests were not published, and Resume
+// should be used to continue.
+func (p *IPNIPublisher) PublishSegmented(ctx context.Context, providerInfo peer.AddrInfo, contextID string, digests iter.Seq[mh.Multihash], meta metadata.Metadata, segmentSize int) (ipld.Link, error) {
+	segmentSize = p.resolveSegmentSize(segmentSize)
+	return p.runSegments(ctx, providerInfo, contextID, meta, segmentSize, 0, nil, 0, digests)
+}
+
+// Resume continues a segmented publish that previously returned an error,
+// by re-deriving how many segments of contextID are already in the
+// advertisement chain, and how many digests they account for, and skipping
+// that many digests from the front of digests before resuming. digests must
+// be the same sequence, in the same order, originally given to
+// PublishSegmented: since a generator's pull position cannot be persisted,
+// only the caller can reproduce it across a process restart.
+//
+// Because the resume point is re-derived from the chain itself rather than
+// from in-memory state, Resume works after a crash and process restart, not
+// only after an in-process error.
+//
+// It returns ErrNoCheckpoint if the chain has no advertisement for
+// contextID's segments, i.e. PublishSegmented was never called for it, or
+// never got far enough to publish a single segment.
+func (p *IPNIPublisher) Resume(ctx context.Context, providerInfo peer.AddrInfo, contextID string, digests iter.Seq[mh.Multihash], meta metadata.Metadata, segmentSize int) (ipld.Link, error) {
+	segmentSize = p.resolveSegmentSize(segmentSize)
+
+	index, skip, lastLink, err := p.segmentProgress(ctx, providerInfo.ID, contextID)
+	if err != nil {
+		return nil, err
+	}
+	if index == 0 {
+		return nil, ErrNoCheckpoint
+	}
+
+	return p.runSegments(ctx, providerInfo, contextID, meta, segmentSize, index, lastLink, skip, digests)
+}
+
+func (p *IPNIPublisher) resolveSegmentSize(segmentSize int) int {
+	if segmentSize <= 0 {
+		segmentSize = p.segmentSize
+	}
+	if segmentSize <= 0 {
+		segmentSize = defaultSegmentSize
+	}
+	return segmentSize
+}
+
+// runSegments publishes one advertisement per segmentSize digests pulled
+// from digests, starting at index, until digests is exhausted or publishing
+// a segment fails. Each segment is chained onto the publisher's current head,
+// like any other advertisement; lastLink is what is returned if no segment
+// gets published. The first skip digests are discarded unpublished, to pick
+// up after segments already published by an earlier call.
+func (p *IPNIPublisher) runSegments(ctx context.Context, providerInfo peer.AddrInfo, contextID string, meta metadata.Metadata, segmentSize, index int, lastLink ipld.Link, skip int, digests iter.Seq[mh.Multihash]) (ipld.Link, error) {
+	next, stop := iter.Pull(digests)
+	defer stop()
+
+	for i := 0; i < skip; i++ {
+		if _, ok := next(); !ok {
+			break
+		}
+	}
+
+	for {
+		batch := make([]mh.Multihash, 0, segmentSize)
+		for len(batch) < segmentSize {
+			d, ok := next()
+			if !ok {
+				break
+			}
+			batch = append(batch, d)
+		}
+		if len(batch) == 0 {
+			return lastLink, nil
+		}
+
+		segContextID := segmentContextID(contextID, index)
+		link, err := p.enqueue(ctx, providerInfo, segContextID, meta, false, slices.Values(batch))
+		if err != nil {
+			return lastLink, fmt.Errorf("publishing segment %d of %q: %w", index, contextID, err)
+		}
+
+		index++
+		lastLink = link
+	}
+}
+
+// segmentProgress walks the advertisement chain back from the current head,
+// looking for the advertisements PublishSegmented already published for
+// (providerID, contextID), to re-derive how far a segmented publish got.
+//
+// It returns the number of segments found (0 if none), the total number of
+// digests they contain (the count Resume must skip from the front of the
+// caller's digests), and the link of the last one, which Resume returns if
+// there are no digests left to publish.
+func (p *IPNIPublisher) segmentProgress(ctx context.Context, providerID peer.ID, contextID string) (segments, digests int, lastLink ipld.Link, err error) {
+	head, err := p.store.Head(ctx)
+	if err != nil {
+		if store.IsNotFound(err) {
+			return 0, 0, nil, nil
+		}
+		return 0, 0, nil, fmt.Errorf("reading head: %w", err)
+	}
+
+	type found struct {
+		link    ipld.Link
+		digests int
+	}
+	byIndex := make(map[int]found)
+
+	cur := head.Head
+	for cur != nil {
+		ad, err := p.store.Advert(ctx, cur)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("reading advertisement %s: %w", cur, err)
+		}
+
+		idx, ok := parseSegmentContextID(ad.ContextID, contextID)
+		if ok && ad.Provider == providerID.String() {
+			if _, seen := byIndex[idx]; !seen {
+				n, err := countEntries(ctx, p.store, ad.Entries)
+				if err != nil {
+					return 0, 0, nil, fmt.Errorf("counting entries of segment %d of %q: %w", idx, contextID, err)
+				}
+				byIndex[idx] = found{link: cur, digests: n}
+			}
+			if idx == 0 {
+				break
+			}
+		}
+		cur = ad.PreviousID
+	}
+
+	if len(byIndex) == 0 {
+		return 0, 0, nil, nil
+	}
+
+	maxIndex := -1
+	for idx := range byIndex {
+		if idx > maxIndex {
+			maxIndex = idx
+		}
+	}
+	for i := 0; i <= maxIndex; i++ {
+		f, ok := byIndex[i]
+		if !ok {
+			return 0, 0, nil, fmt.Errorf("segmented publish checkpoint for %q is missing segment %d", contextID, i)
+		}
+		digests += f.digests
+	}
+	return maxIndex + 1, digests, byIndex[maxIndex].link, nil
+}
+
+func countEntries(ctx context.Context, s store.PublisherStore, root ipld.Link) (int, error) {
+	n := 0
+	for _, err := range s.Entries(ctx, root) {
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// segmentContextID derives the context ID used for the advertisement of an
+// individual segment, so that each segment's entries and metadata are
+// tracked independently in the store.
+func segmentContextID(contextID string, index int) []byte {
+	return []byte(fmt.Sprintf("%s/segment/%d", contextID, index))
+}
+
+// parseSegmentContextID reports whether adContextID is the context ID
+// segmentContextID would derive for contextID at some index, and if so,
+// that index.
+func parseSegmentContextID(adContextID []byte, contextID string) (int, bool) {
+	prefix := contextID + "/segment/"
+	s := string(adContextID)
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(s[len(prefix):])
+	if err != nil {
+		return 0, false
+	}
+	return index, true
+}
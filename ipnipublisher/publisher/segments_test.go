@@ -0,0 +1,198 @@
+package publisher_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/ipni-publisher/ipnipublisher/publisher"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPublishSegmentedChainsSegments checks that PublishSegmented splits a
+// digest stream into the expected number of segments and chains them onto
+// the same advertisement chain as a regular Publish call.
+func TestPublishSegmentedChainsSegments(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	provInfo := peer.AddrInfo{ID: pid}
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	pub, err := publisher.New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	ctx := context.Background()
+	const segmentSize = 4
+	const segmentCount = 3
+	digests := make([]mh.Multihash, segmentSize*segmentCount)
+	for i := range digests {
+		digests[i] = randomMultihash(t)
+	}
+
+	link, err := pub.PublishSegmented(ctx, provInfo, "segmented-context", slices.Values(digests), metadata.Default.New(&metadata.Bitswap{}), segmentSize)
+	require.NoError(t, err)
+	require.NotNil(t, link)
+
+	// Walk back from the head: there should be exactly segmentCount
+	// advertisements belonging to this publish, each with a distinct link.
+	head, err := st.Head(ctx)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool, segmentCount)
+	cur := head.Head
+	for i := 0; i < segmentCount; i++ {
+		require.NotNil(t, cur)
+		require.False(t, seen[cur.String()])
+		seen[cur.String()] = true
+		ad, err := st.Advert(ctx, cur)
+		require.NoError(t, err)
+		cur = ad.PreviousID
+	}
+	require.Len(t, seen, segmentCount)
+
+	// Resuming a completed segmented publish is a harmless no-op: every
+	// digest is re-derived as already published, so nothing is re-sent and
+	// the same final link is returned.
+	resumeLink, err := pub.Resume(ctx, provInfo, "segmented-context", slices.Values(digests), metadata.Default.New(&metadata.Bitswap{}), segmentSize)
+	require.NoError(t, err)
+	require.Equal(t, link, resumeLink)
+
+	_, err = pub.Resume(ctx, provInfo, "never-started-context", slices.Values(digests), metadata.Default.New(&metadata.Bitswap{}), segmentSize)
+	require.ErrorIs(t, err, publisher.ErrNoCheckpoint)
+}
+
+// failingStore wraps a PublisherStore and fails the Nth call to PutAdvert,
+// to simulate a segmented publish being interrupted partway through.
+type failingStore struct {
+	store.PublisherStore
+	failOnCall int
+	calls      int
+}
+
+func (s *failingStore) PutAdvert(ctx context.Context, adv schema.Advertisement) (ipld.Link, error) {
+	s.calls++
+	if s.calls == s.failOnCall {
+		return nil, errors.New("simulated store failure")
+	}
+	return s.PublisherStore.PutAdvert(ctx, adv)
+}
+
+// TestPublishSegmentedResume checks that, after a segment fails to publish,
+// Resume continues from the next digest rather than restarting, and the
+// resulting chain still has exactly one advertisement per segment.
+func TestPublishSegmentedResume(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	provInfo := peer.AddrInfo{ID: pid}
+
+	base := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	st := &failingStore{PublisherStore: base, failOnCall: 2}
+	pub, err := publisher.New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pub.Close(context.Background()))
+	})
+
+	ctx := context.Background()
+	const segmentSize = 4
+	const segmentCount = 3
+	digests := make([]mh.Multihash, segmentSize*segmentCount)
+	for i := range digests {
+		digests[i] = randomMultihash(t)
+	}
+
+	meta := metadata.Default.New(&metadata.Bitswap{})
+	_, err = pub.PublishSegmented(ctx, provInfo, "resumable-context", slices.Values(digests), meta, segmentSize)
+	require.Error(t, err)
+
+	link, err := pub.Resume(ctx, provInfo, "resumable-context", slices.Values(digests), meta, segmentSize)
+	require.NoError(t, err)
+	require.NotNil(t, link)
+
+	head, err := base.Head(ctx)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool, segmentCount)
+	cur := head.Head
+	for i := 0; i < segmentCount; i++ {
+		require.NotNil(t, cur)
+		seen[cur.String()] = true
+		ad, err := base.Advert(ctx, cur)
+		require.NoError(t, err)
+		cur = ad.PreviousID
+	}
+	require.Len(t, seen, segmentCount)
+}
+
+// TestPublishSegmentedResumeAfterRestart checks that Resume can pick up a
+// segmented publish on a brand new IPNIPublisher sharing the same store,
+// simulating a process restart where no in-memory state survives: the
+// resume point must be re-derived entirely from the advertisement chain.
+func TestPublishSegmentedResumeAfterRestart(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	provInfo := peer.AddrInfo{ID: pid}
+
+	base := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	failing := &failingStore{PublisherStore: base, failOnCall: 2}
+
+	ctx := context.Background()
+	const segmentSize = 4
+	const segmentCount = 3
+	digests := make([]mh.Multihash, segmentSize*segmentCount)
+	for i := range digests {
+		digests[i] = randomMultihash(t)
+	}
+	meta := metadata.Default.New(&metadata.Bitswap{})
+
+	crashed, err := publisher.New(priv, failing)
+	require.NoError(t, err)
+	_, err = crashed.PublishSegmented(ctx, provInfo, "restart-context", slices.Values(digests), meta, segmentSize)
+	require.Error(t, err)
+	// Simulate a crash: no Close, no chance for in-memory state to be
+	// carried over to the next IPNIPublisher.
+
+	restarted, err := publisher.New(priv, base)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, restarted.Close(context.Background()))
+	})
+
+	link, err := restarted.Resume(ctx, provInfo, "restart-context", slices.Values(digests), meta, segmentSize)
+	require.NoError(t, err)
+	require.NotNil(t, link)
+
+	head, err := base.Head(ctx)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool, segmentCount)
+	cur := head.Head
+	for i := 0; i < segmentCount; i++ {
+		require.NotNil(t, cur)
+		seen[cur.String()] = true
+		ad, err := base.Advert(ctx, cur)
+		require.NoError(t, err)
+		cur = ad.PreviousID
+	}
+	require.Len(t, seen, segmentCount)
+}
@@ -0,0 +1,151 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// requestBufferSize is the size of the buffered channel used to queue
+// publish requests for the single-writer goroutine.
+const requestBufferSize = 64
+
+// publishRequest is a unit of work submitted to the publisher's single
+// writer goroutine.
+type publishRequest struct {
+	ctx       context.Context
+	provider  peer.AddrInfo
+	contextID []byte
+	digests   iter.Seq[mh.Multihash]
+	meta      metadata.Metadata
+	isRm      bool
+	reply     chan<- publishReply
+
+	// raw, if set, is an already-built and signed advertisement to store
+	// and announce as-is, instead of one built from the fields above. Used
+	// by PublishAdvertisement.
+	raw *schema.Advertisement
+}
+
+// key identifies the (peer, contextID) pair a request advertises for, so
+// that requests for the same pair can be coalesced into a single advert.
+// Raw requests are never coalesced with one another, since each carries an
+// advertisement that was already fully built by the caller.
+func (r publishRequest) key() string {
+	if r.raw != nil {
+		return fmt.Sprintf("raw:%p", r.reply)
+	}
+	return r.provider.ID.String() + "/" + string(r.contextID)
+}
+
+type publishReply struct {
+	link ipld.Link
+	err  error
+}
+
+// run is the single writer goroutine that serializes calls to
+// publishAdvForIndex, so that the advert chain is only ever built by one
+// goroutine at a time. It is the mechanism that makes Publish safe to call
+// concurrently.
+func (p *IPNIPublisher) run() {
+	defer close(p.done)
+	for req := range p.requests {
+		batch := []publishRequest{req}
+	drain:
+		for {
+			select {
+			case req, ok := <-p.requests:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, req)
+			default:
+				break drain
+			}
+		}
+		p.processBatch(batch)
+	}
+}
+
+// processBatch publishes a batch of requests drained from the request
+// channel in one pass of the writer goroutine. Requests that share a
+// (peer, contextID) pair are coalesced: only the most recent one is
+// actually published. Every other request sharing the pair gets
+// ErrSuperseded instead of that result, since its own digests and metadata
+// were discarded rather than published.
+func (p *IPNIPublisher) processBatch(batch []publishRequest) {
+	order := make([]string, 0, len(batch))
+	latest := make(map[string]publishRequest, len(batch))
+	superseded := make(map[string][]chan<- publishReply, len(batch))
+
+	for _, req := range batch {
+		k := req.key()
+		if prev, ok := latest[k]; ok {
+			superseded[k] = append(superseded[k], prev.reply)
+		} else {
+			order = append(order, k)
+		}
+		latest[k] = req
+	}
+
+	for _, k := range order {
+		req := latest[k]
+		var link ipld.Link
+		var err error
+		if req.raw != nil {
+			link, err = p.publish(req.ctx, *req.raw)
+		} else {
+			link, err = p.publishAdvForIndex(req.ctx, req.provider.ID, req.provider.Addrs, req.contextID, req.meta, req.isRm, req.digests)
+		}
+		req.reply <- publishReply{link: link, err: err}
+		for _, reply := range superseded[k] {
+			reply <- publishReply{err: ErrSuperseded}
+		}
+	}
+}
+
+// enqueue submits a publish request to the writer goroutine and blocks until
+// it has been published, or ctx is cancelled.
+func (p *IPNIPublisher) enqueue(ctx context.Context, provider peer.AddrInfo, contextID []byte, meta metadata.Metadata, isRm bool, digests iter.Seq[mh.Multihash]) (ipld.Link, error) {
+	reply := make(chan publishReply, 1)
+	req := publishRequest{ctx: ctx, provider: provider, contextID: contextID, digests: digests, meta: meta, isRm: isRm, reply: reply}
+	return p.submit(ctx, req, reply)
+}
+
+// enqueueRaw submits an already-built advertisement to the writer goroutine,
+// to be stored and announced as-is. It blocks until that has happened, or
+// ctx is cancelled.
+func (p *IPNIPublisher) enqueueRaw(ctx context.Context, adv schema.Advertisement) (ipld.Link, error) {
+	reply := make(chan publishReply, 1)
+	req := publishRequest{ctx: ctx, raw: &adv, reply: reply}
+	return p.submit(ctx, req, reply)
+}
+
+func (p *IPNIPublisher) submit(ctx context.Context, req publishRequest, reply chan publishReply) (ipld.Link, error) {
+	p.closeMu.RLock()
+	if p.closed {
+		p.closeMu.RUnlock()
+		return nil, ErrPublisherClosed
+	}
+
+	select {
+	case p.requests <- req:
+		p.closeMu.RUnlock()
+	case <-ctx.Done():
+		p.closeMu.RUnlock()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case r := <-reply:
+		return r.link, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package publisher
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProcessBatchCoalescesSameContextID drives two requests for the same
+// (peer, contextID) through a single processBatch call, the situation
+// TestPublishConcurrent's distinct-contextID-per-goroutine design never
+// exercises. It checks that only the more recent request is actually
+// published, and that the superseded request gets ErrSuperseded rather
+// than being silently handed a result for digests and metadata that were
+// never its own.
+func TestProcessBatchCoalescesSameContextID(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	provInfo := peer.AddrInfo{ID: pid}
+
+	st := store.FromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	p, err := New(priv, st)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, p.Close(context.Background()))
+	})
+
+	ctx := context.Background()
+	contextID := []byte("shared-context")
+
+	firstDigest := testMultihash(t)
+	secondDigest := testMultihash(t)
+	firstMeta := metadata.Default.New(&metadata.Bitswap{})
+	secondMeta := metadata.Default.New(&metadata.IpfsGatewayHttp{})
+
+	firstReply := make(chan publishReply, 1)
+	secondReply := make(chan publishReply, 1)
+	batch := []publishRequest{
+		{
+			ctx: ctx, provider: provInfo, contextID: contextID,
+			digests: slices.Values([]mh.Multihash{firstDigest}), meta: firstMeta, reply: firstReply,
+		},
+		{
+			ctx: ctx, provider: provInfo, contextID: contextID,
+			digests: slices.Values([]mh.Multihash{secondDigest}), meta: secondMeta, reply: secondReply,
+		},
+	}
+
+	p.processBatch(batch)
+
+	firstResult := <-firstReply
+	secondResult := <-secondReply
+	require.ErrorIs(t, firstResult.err, ErrSuperseded, "the superseded request must not get a silent, borrowed result")
+	require.NoError(t, secondResult.err)
+	require.NotNil(t, secondResult.link)
+
+	adv, err := st.Advert(ctx, secondResult.link)
+	require.NoError(t, err)
+
+	secondMetaBytes, err := secondMeta.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, secondMetaBytes, []byte(adv.Metadata), "the more recent request's metadata should be the one published")
+}
+
+func testMultihash(t *testing.T) mh.Multihash {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	digest, err := mh.Sum(b, mh.SHA2_256, -1)
+	require.NoError(t, err)
+	return digest
+}